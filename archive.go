@@ -0,0 +1,131 @@
+package filestore
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveFormat задает формат архива, отдаваемого Store.Archive.
+type ArchiveFormat string
+
+// Поддерживаемые значения ArchiveFormat.
+const (
+	ArchiveTar ArchiveFormat = "tar"
+	ArchiveZip ArchiveFormat = "zip"
+)
+
+// ErrUnsupportedFormat возвращается Archive для неизвестного ArchiveFormat.
+var ErrUnsupportedFormat = errors.New("filestore: unsupported archive format")
+
+// Archive обходит все файлы в prefix и отдает их потоком в виде tar- или
+// zip-архива в w, не буферизуя архив целиком в памяти. Поскольку имена
+// файлов в хранилище - это непрозрачные хеши, в архиве используется
+// схема именования "hash.ext", где расширение берется из mimetype файла
+// (см. Meta, сохраняемую Create). Время модификации записи в архиве - это
+// время последнего обращения к файлу, отслеживаемое Store через Chtimes.
+func (s *Store) Archive(prefix string, w io.Writer, format ArchiveFormat) error {
+	switch format {
+	case ArchiveTar:
+		return s.archiveTar(prefix, w)
+	case ArchiveZip:
+		return s.archiveZip(prefix, w)
+	default:
+		return ErrUnsupportedFormat
+	}
+}
+
+func (s *Store) archiveTar(prefix string, w io.Writer) error {
+	var tw = tar.NewWriter(w)
+	defer tw.Close()
+	return s.walkPrefix(prefix, func(k string, info os.FileInfo) error {
+		file, err := s.backend.Open(k)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		var hdr = &tar.Header{
+			Name:    archiveName(prefix, k, s.backend),
+			Mode:    0644,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, file)
+		return err
+	})
+}
+
+func (s *Store) archiveZip(prefix string, w io.Writer) error {
+	var zw = zip.NewWriter(w)
+	defer zw.Close()
+	return s.walkPrefix(prefix, func(k string, info os.FileInfo) error {
+		file, err := s.backend.Open(k)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		var hdr = &zip.FileHeader{
+			Name:     archiveName(prefix, k, s.backend),
+			Method:   zip.Deflate,
+			Modified: info.ModTime(),
+		}
+		entry, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, file)
+		return err
+	})
+}
+
+// walkPrefix обходит блобы хранилища, хранящиеся под prefix, пропуская
+// файлы метаданных (см. meta.go).
+func (s *Store) walkPrefix(prefix string, fn func(k string, info os.FileInfo) error) error {
+	return s.backend.Walk(func(k string, info os.FileInfo) error {
+		if strings.HasSuffix(k, metaSuffix) {
+			return nil
+		}
+		if prefix != "" && k != prefix && !strings.HasPrefix(k, prefix+string(filepath.Separator)) {
+			return nil
+		}
+		return fn(k, info)
+	})
+}
+
+// archiveName восстанавливает хеш-имя файла по его ключу в Backend и
+// подбирает расширение по mimetype, сохраненному в метаданных блоба.
+func archiveName(prefix, k string, b Backend) string {
+	var rel, name = k, k
+	if prefix == "" {
+		rel = k
+	} else if r, err := filepath.Rel(prefix, k); err == nil {
+		rel = r
+	}
+	name = strings.ReplaceAll(rel, string(filepath.Separator), "")
+
+	var mimetype string
+	if meta, err := loadMeta(b, k+metaSuffix); err == nil && len(meta.Uploads) > 0 {
+		mimetype = meta.Uploads[0].Mimetype
+	}
+	return name + extensionFor(mimetype)
+}
+
+// extensionFor подбирает расширение файла по его mimetype.
+func extensionFor(mimetype string) string {
+	if mimetype == "" {
+		return ""
+	}
+	exts, err := mime.ExtensionsByType(mimetype)
+	if err != nil || len(exts) == 0 {
+		return ""
+	}
+	return exts[0]
+}
@@ -0,0 +1,141 @@
+package filestore
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestArchiveTar проверяет, что Archive(ArchiveTar) отдает все файлы
+// префикса единым tar-потоком, с именами вида "hash.ext".
+func TestArchiveTar(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := s.Create("docs", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = s.Archive("docs", &buf, ArchiveTar); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(&buf)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// archiveName добавляет расширение по сниффнутому mimetype ("hash.ext"),
+	// само расширение зависит от системной таблицы mime.types, так что
+	// проверяем только неизменную часть имени - само хеш-имя.
+	if !strings.HasPrefix(hdr.Name, fi.Name) {
+		t.Fatalf("hdr.Name = %q, want prefix %q", hdr.Name, fi.Name)
+	}
+	data, err := io.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("content = %q, want hello", data)
+	}
+	if _, err = tr.Next(); err != io.EOF {
+		t.Fatalf("лишняя запись в архиве: err = %v", err)
+	}
+}
+
+// TestArchiveZip проверяет тот же сценарий для ArchiveZip.
+func TestArchiveZip(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := s.Create("docs", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = s.Archive("docs", &buf, ArchiveZip); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 {
+		t.Fatalf("len(zr.File) = %d, want 1", len(zr.File))
+	}
+	if !strings.HasPrefix(zr.File[0].Name, fi.Name) {
+		t.Fatalf("Name = %q, want prefix %q", zr.File[0].Name, fi.Name)
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("content = %q, want hello", data)
+	}
+}
+
+// TestArchiveUnsupportedFormat проверяет, что неизвестный ArchiveFormat
+// отклоняется ErrUnsupportedFormat, не записав в w ни байта.
+func TestArchiveUnsupportedFormat(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = s.Archive("", &buf, ArchiveFormat("rar")); err != ErrUnsupportedFormat {
+		t.Fatalf("err = %v, want ErrUnsupportedFormat", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("buf.Len() = %d, want 0", buf.Len())
+	}
+}
+
+// TestArchiveOnlyUnderPrefix проверяет, что Archive включает только файлы
+// запрошенного префикса, не затрагивая остальное хранилище.
+func TestArchiveOnlyUnderPrefix(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Create("a", strings.NewReader("in-a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Create("b", strings.NewReader("in-b")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = s.Archive("a", &buf, ArchiveTar); err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(&buf)
+	count := 0
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	if count != 1 {
+		t.Fatalf("count = %d, want 1 (только файлы из префикса a)", count)
+	}
+}
@@ -0,0 +1,44 @@
+package filestore
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Backend описывает низкоуровневое хранилище, на основе которого строится
+// Store. Все методы оперируют уже вычисленным ключом файла (hash-derived
+// путь вида "name[:1]/name[1:3]/name[3:]", при необходимости с префиксом) и
+// не должны ничего знать о хешировании содержимого - этим занимается Store.
+type Backend interface {
+	// Put сохраняет содержимое r по указанному ключу. Реализация должна
+	// быть атомарной: до завершения записи по ключу не должно появляться
+	// частично записанного файла.
+	Put(key string, r io.Reader) error
+	// Open открывает файл по ключу для чтения. Возвращаемый io.ReadSeekCloser
+	// необходим, т.к. отдача файлов по HTTP (http.ServeContent) требует
+	// поддержки Seek для обработки Range-запросов.
+	Open(key string) (io.ReadSeekCloser, error)
+	// Stat возвращает информацию о файле по ключу.
+	Stat(key string) (os.FileInfo, error)
+	// SetModTime обновляет время модификации/доступа файла. Используется
+	// для отслеживания последнего обращения к файлу при дедупликации и
+	// последующей чистке устаревших файлов.
+	SetModTime(key string, t time.Time) error
+	// Remove удаляет файл по ключу вместе с образовавшимися пустыми
+	// родительскими каталогами (если это применимо для данной реализации).
+	Remove(key string) error
+	// Walk обходит все файлы хранилища, вызывая fn для каждого из них.
+	Walk(fn func(key string, info os.FileInfo) error) error
+}
+
+// cheapModTimeBackend - опциональное расширение Backend: реализующие его
+// бэкенды сигнализируют, что SetModTime у них дешева (не требует запроса к
+// удаленному серверу), так что Store.Open может невозбранно дергать ее при
+// каждом чтении, отслеживая время последнего доступа (см. Store.Open).
+// localBackend реализует его через обычный os.Chtimes; S3Backend - нет:
+// там SetModTime - это полноценный copy-object-на-себя запрос (см.
+// S3Backend.SetModTime), и делать это на каждое скачивание неприемлемо.
+type cheapModTimeBackend interface {
+	cheapSetModTime()
+}
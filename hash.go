@@ -0,0 +1,135 @@
+package filestore
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"lukechampine.com/blake3"
+)
+
+// HashAlgo перечисляет дополнительные алгоритмы хеширования, которые можно
+// попросить Store посчитать при сохранении файла, помимо всегда считаемых
+// CRC32 и MD5.
+type HashAlgo string
+
+// Поддерживаемые значения HashAlgo.
+const (
+	SHA1   HashAlgo = "sha1"
+	SHA256 HashAlgo = "sha256"
+	SHA512 HashAlgo = "sha512"
+	BLAKE3 HashAlgo = "blake3"
+)
+
+// newHash возвращает новый экземпляр хешера для данного алгоритма, либо nil
+// для неизвестного значения.
+func newHash(algo HashAlgo) hash.Hash {
+	switch algo {
+	case SHA1:
+		return sha1.New()
+	case SHA256:
+		return sha256.New()
+	case SHA512:
+		return sha512.New()
+	case BLAKE3:
+		return blake3.New(32, nil)
+	default:
+		return nil
+	}
+}
+
+// StoreOption задает дополнительные настройки хранилища, передаваемые в
+// Open/OpenBackend.
+type StoreOption func(*Store)
+
+// nameHashConfig описывает алгоритм, используемый для получения хеш-имени
+// файла вместо комбинации crc32|md5 по умолчанию.
+type nameHashConfig struct {
+	algo HashAlgo
+	size int // если > 0, сумма усекается до этого числа байт
+}
+
+// encodedLen возвращает длину base64-имени, получаемого из этого хеша - с
+// учетом усечения до size, если оно задано. Используется вместо
+// захардкоженной длины имени по умолчанию везде, где имя нужно провалидировать
+// до обращения к Backend (см. Store.minNameLen).
+func (c *nameHashConfig) encodedLen() int {
+	var n = c.size
+	if n <= 0 {
+		if h := newHash(c.algo); h != nil {
+			n = h.Size()
+		}
+	}
+	return base64.RawURLEncoding.EncodedLen(n)
+}
+
+// WithHashes включает в FileInfo.Hashes дополнительные контрольные суммы
+// содержимого, посчитанные в один проход с CRC32/MD5 при сохранении файла.
+func WithHashes(algos ...HashAlgo) StoreOption {
+	return func(s *Store) { s.hashes = algos }
+}
+
+// WithNameHash задает алгоритм получения хеш-имени файла вместо связки
+// crc32|md5, используемой по умолчанию. Если size > 0, сумма усекается до
+// первых size байт - это позволяет мигрировать на более стойкие хеши, не
+// меняя при этом длину и раскладку каталогов с данными.
+func WithNameHash(algo HashAlgo, size int) StoreOption {
+	return func(s *Store) { s.nameHash = &nameHashConfig{algo: algo, size: size} }
+}
+
+// VerifyResult - это результат проверки целостности файла в Store.Verify.
+type VerifyResult struct {
+	Name     string `json:"name"`
+	Computed string `json:"computed"`
+	Match    bool   `json:"match"`
+}
+
+// Verify перечитывает файл с диска, заново вычисляет его хеш-имя и
+// сравнивает с тем, под которым он сохранен - это позволяет обнаружить
+// повреждение данных при фоновой сверке хранилища.
+func (s *Store) Verify(prefix, name string) (*VerifyResult, error) {
+	if len(name) < s.minNameLen() {
+		return nil, ErrNotFound
+	}
+	file, err := s.backend.Open(key(prefix, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var computed string
+	if s.nameHash != nil {
+		h := newHash(s.nameHash.algo)
+		if _, err = io.Copy(h, file); err != nil {
+			return nil, err
+		}
+		computed = base64.RawURLEncoding.EncodeToString(truncateSum(h.Sum(nil), s.nameHash.size))
+	} else {
+		// имя по умолчанию - это crc32|md5 содержимого (см. Store.Create)
+		var crc32sum, md5sum = crc32.NewIEEE(), md5.New()
+		if _, err = io.Copy(io.MultiWriter(crc32sum, md5sum), file); err != nil {
+			return nil, err
+		}
+		computed = base64.RawURLEncoding.EncodeToString(
+			append(crc32sum.Sum(nil), md5sum.Sum(nil)...))
+	}
+	return &VerifyResult{Name: name, Computed: computed, Match: computed == name}, nil
+}
+
+// truncateSum усекает сумму до заданного числа байт, если size > 0 и сумма
+// длиннее.
+func truncateSum(sum []byte, size int) []byte {
+	if size > 0 && size < len(sum) {
+		return sum[:size]
+	}
+	return sum
+}
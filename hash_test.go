@@ -0,0 +1,98 @@
+package filestore
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// TestCreateWithHashes проверяет, что WithHashes считает запрошенные
+// дополнительные контрольные суммы в один проход с основным именем и
+// кладет их в FileInfo.Hashes.
+func TestCreateWithHashes(t *testing.T) {
+	s, err := Open(t.TempDir(), WithHashes(SHA256, BLAKE3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := s.Create("", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fi.Hashes) != 2 {
+		t.Fatalf("Hashes = %+v, want 2 entries", fi.Hashes)
+	}
+	if fi.Hashes[SHA256] == "" || fi.Hashes[BLAKE3] == "" {
+		t.Fatalf("Hashes = %+v, хотим непустые sha256 и blake3", fi.Hashes)
+	}
+}
+
+// TestCreateWithNameHash проверяет, что WithNameHash переключает имя файла
+// на заданный алгоритм (вместо crc32|md5 по умолчанию) и что получившееся
+// имя проходит собственный Store.minNameLen.
+func TestCreateWithNameHash(t *testing.T) {
+	s, err := Open(t.TempDir(), WithNameHash(SHA256, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := s.Create("", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := newHash(SHA256)
+	h.Write([]byte("hello"))
+	want := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+	if fi.Name != want {
+		t.Fatalf("Name = %q, want %q", fi.Name, want)
+	}
+	if _, err = s.Stat("", fi.Name); err != nil {
+		t.Fatalf("Stat по имени, посчитанному WithNameHash: %v", err)
+	}
+}
+
+// TestVerify проверяет, что Verify пересчитывает хеш-имя содержимого с
+// диска и сообщает о совпадении/несовпадении - как для имени по умолчанию,
+// так и для WithNameHash.
+func TestVerify(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := s.Create("", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Verify("", fi.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Match || res.Computed != fi.Name {
+		t.Fatalf("res = %+v, want Match=true Computed=%q", res, fi.Name)
+	}
+
+	if _, err = s.Verify("", strings.Repeat("x", s.minNameLen())); err != ErrNotFound {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
+
+// TestVerifyWithNameHash проверяет Verify при нестандартном алгоритме
+// хеш-имени, заданном через WithNameHash.
+func TestVerifyWithNameHash(t *testing.T) {
+	s, err := Open(t.TempDir(), WithNameHash(BLAKE3, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := s.Create("", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Verify("", fi.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Match {
+		t.Fatalf("res = %+v, want Match=true", res)
+	}
+}
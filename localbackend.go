@@ -0,0 +1,116 @@
+package filestore
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// localBackend реализует Backend поверх локальной файловой системы: это
+// исходная реализация Store, вынесенная в отдельный драйвер.
+type localBackend struct {
+	root string
+}
+
+// newLocalBackend создает каталог root, если он еще не создан, и возвращает
+// драйвер локального хранилища.
+func newLocalBackend(root string) (*localBackend, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+	return &localBackend{root: root}, nil
+}
+
+// fullname возвращает полный путь к файлу по ключу.
+func (b *localBackend) fullname(key string) string {
+	return filepath.Join(b.root, key)
+}
+
+// Put сохраняет содержимое r по указанному ключу. Запись ведется во
+// временный файл с последующим переименованием, чтобы по ключу не мог
+// оказаться частично записанный файл.
+func (b *localBackend) Put(key string, r io.Reader) error {
+	// создаем временный файл в корневом каталоге
+	tmpfile, err := ioutil.TempFile(b.root, "~tmp")
+	if err != nil {
+		err.(*os.PathError).Path = tmpfileName // подменяем имя файла
+		return err
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err = io.Copy(tmpfile, r); err != nil {
+		tmpfile.Close()
+		return &os.PathError{Op: "write", Path: tmpfileName, Err: err}
+	}
+	if err = tmpfile.Close(); err != nil {
+		if e, ok := err.(*os.PathError); ok {
+			e.Path = tmpfileName
+		}
+		return err
+	}
+	// создаем каталог для файла, если он еще не создан
+	var name = b.fullname(key)
+	if err = os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	// перемещаем временный файл на его постоянное место
+	if err = os.Rename(tmpfile.Name(), name); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Open открывает файл по ключу для чтения.
+func (b *localBackend) Open(key string) (io.ReadSeekCloser, error) {
+	return os.Open(b.fullname(key))
+}
+
+// Stat возвращает информацию о файле по ключу.
+func (b *localBackend) Stat(key string) (os.FileInfo, error) {
+	return os.Stat(b.fullname(key))
+}
+
+// SetModTime обновляет время модификации и доступа к файлу.
+func (b *localBackend) SetModTime(key string, t time.Time) error {
+	return os.Chtimes(b.fullname(key), t, t)
+}
+
+// cheapSetModTime помечает localBackend как реализующий cheapModTimeBackend:
+// здесь SetModTime - это просто os.Chtimes.
+func (b *localBackend) cheapSetModTime() {}
+
+// Remove удаляет файл по ключу и образовавшиеся после этого пустые
+// родительские каталоги (в пределах hash-shard вложенности).
+func (b *localBackend) Remove(key string) error {
+	var name = b.fullname(key)
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+	// пытаемся удалить пустые каталоги, если они образовались
+	for i := 0; i < 2; i++ {
+		name = filepath.Dir(name)
+		if err := os.Remove(name); err != nil {
+			break // если не получилось, значит каталог не пустой
+		}
+	}
+	return nil
+}
+
+// Walk обходит все файлы хранилища.
+func (b *localBackend) Walk(fn func(key string, info os.FileInfo) error) error {
+	return filepath.Walk(b.root, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		key, err := filepath.Rel(b.root, filename)
+		if err != nil {
+			return err
+		}
+		return fn(key, info)
+	})
+}
@@ -0,0 +1,68 @@
+package filestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// ErrInvalidDeleteKey возвращается Remove, если для файла был задан
+// DeleteKey при создании, а переданный в Remove ключ ему не соответствует.
+var ErrInvalidDeleteKey = errors.New("filestore: invalid delete key")
+
+// metaSuffix - это суффикс ключа вспомогательного JSON-файла с метаданными,
+// который хранится рядом с самим содержимым блоба.
+const metaSuffix = ".meta"
+
+// Upload описывает одну логическую загрузку файла, содержимое которого
+// совпало с уже сохраненным блобом (либо стало первой его копией).
+type Upload struct {
+	Filename  string    `json:"filename,omitempty"`
+	Mimetype  string    `json:"mimetype"`
+	DeleteKey string    `json:"delete_key,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// Meta - это метаданные блоба: сколько логических загрузок на него
+// ссылается и что о них известно. Хранится как JSON-файл рядом с блобом.
+type Meta struct {
+	RefCount int       `json:"refcount"`
+	Uploads  []Upload  `json:"uploads"`
+	Accessed time.Time `json:"accessed"`
+}
+
+// loadMeta читает метаданные блоба по ключу метафайла.
+func loadMeta(b Backend, metaKey string) (*Meta, error) {
+	file, err := b.Open(metaKey)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	var meta Meta
+	if err = json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// saveMeta сохраняет метаданные блоба по ключу метафайла.
+func saveMeta(b Backend, metaKey string, meta *Meta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return b.Put(metaKey, bytes.NewReader(data))
+}
+
+// isNotExist сообщает, является ли ошибка признаком отсутствия файла -
+// у разных Backend-ов это может быть os.ErrNotExist, *os.PathError и т.п.
+func isNotExist(err error) bool {
+	return err != nil && os.IsNotExist(err)
+}
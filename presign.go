@@ -0,0 +1,131 @@
+package filestore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNoSigningKey возвращается Presign, если на Store не задан ни один
+// ключ подписи через SetSigningKey.
+var ErrNoSigningKey = errors.New("filestore: no signing key set")
+
+// ErrInvalidToken возвращается, если токен поврежден, подписан неизвестным
+// ключом или привязан к другому клиенту.
+var ErrInvalidToken = errors.New("filestore: invalid token")
+
+// ErrTokenExpired возвращается, если срок действия токена истек.
+var ErrTokenExpired = errors.New("filestore: token expired")
+
+// PresignOption задает дополнительные ограничения подписанной ссылки,
+// создаваемой Presign.
+type PresignOption func(*presignClaims)
+
+// WithClientIP привязывает токен к конкретному IP-адресу клиента: ссылка
+// будет работать только при обращении с этого адреса.
+func WithClientIP(ip string) PresignOption {
+	return func(c *presignClaims) { c.IP = ip }
+}
+
+// WithContentDisposition задает заголовок Content-Disposition, с которым
+// будет отдан файл по подписанной ссылке (например, чтобы задать имя файла
+// при скачивании).
+func WithContentDisposition(value string) PresignOption {
+	return func(c *presignClaims) { c.CD = value }
+}
+
+// presignClaims - это то, что зашифровано (подписано) внутри токена.
+type presignClaims struct {
+	Prefix  string `json:"prefix,omitempty"`
+	Name    string `json:"name"`
+	Expires int64  `json:"expires"`
+	IP      string `json:"ip,omitempty"`
+	CD      string `json:"cd,omitempty"`
+}
+
+// SetSigningKey задает ключи для подписи и проверки токенов, выдаваемых
+// Presign. Первый ключ используется для подписи новых токенов; все
+// перечисленные ключи принимаются при проверке - это позволяет делать
+// ротацию ключей, не инвалидируя уже выданные ссылки: в SetSigningKey
+// передается новый ключ первым, а прежний - вторым, пока не истекут все
+// выданные по нему токены.
+func (s *Store) SetSigningKey(keys ...[]byte) {
+	s.signingKeys = keys
+}
+
+// Presign возвращает подписанный токен, дающий временный доступ к файлу
+// name в prefix в течение ttl, без необходимости аутентификации. Токен
+// проверяется в GetSigned.
+func (s *Store) Presign(prefix, name string, ttl time.Duration, opts ...PresignOption) (string, error) {
+	if len(s.signingKeys) == 0 {
+		return "", ErrNoSigningKey
+	}
+	var claims = presignClaims{
+		Prefix:  prefix,
+		Name:    name,
+		Expires: time.Now().Add(ttl).Unix(),
+	}
+	for _, opt := range opts {
+		opt(&claims)
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	var sig = signToken(s.signingKeys[0], data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." +
+		base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// verifyToken разбирает и проверяет токен, выданный Presign: подпись,
+// срок действия и, если задан, IP-адрес клиента.
+func (s *Store) verifyToken(token, clientIP string) (*presignClaims, error) {
+	var parts = strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+	// Strict, а не просто RawURLEncoding: иначе неиспользуемые биты
+	// последнего символа (подпись - не кратные 3 байтам 32 байта) молча
+	// игнорируются декодером, и разные строки токена перестают быть
+	// взаимно-однозначны с байтами подписи.
+	data, err := base64.RawURLEncoding.Strict().DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.Strict().DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var valid bool
+	for _, key := range s.signingKeys {
+		if hmac.Equal(sig, signToken(key, data)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidToken
+	}
+	var claims presignClaims
+	if err = json.Unmarshal(data, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() > claims.Expires {
+		return nil, ErrTokenExpired
+	}
+	if claims.IP != "" && claims.IP != clientIP {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// signToken подписывает данные токена ключом key.
+func signToken(key, data []byte) []byte {
+	var h = hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,87 @@
+package filestore
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPresignVerifyToken проверяет, что verifyToken принимает только целый,
+// не просроченный токен от ожидаемого клиента, и отклоняет его при
+// подмене подписи, чужом IP или истекшем сроке действия.
+func TestPresignVerifyToken(t *testing.T) {
+	var s Store
+	s.SetSigningKey([]byte("signing-key"))
+
+	token, err := s.Presign("prefix", "name.bin", time.Hour, WithClientIP("1.2.3.4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.verifyToken(token, "1.2.3.4")
+	if err != nil {
+		t.Fatalf("verifyToken: %v", err)
+	}
+	if claims.Prefix != "prefix" || claims.Name != "name.bin" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	if _, err = s.verifyToken(token, "9.9.9.9"); err != ErrInvalidToken {
+		t.Errorf("wrong client IP: err = %v, want ErrInvalidToken", err)
+	}
+
+	// Подменяем символ не в самом конце токена: последний символ base64
+	// подписи кодирует всего 2 значащих бита, и нестрогий декодер мог бы
+	// счесть такую подмену не меняющей декодированные байты - см.
+	// base64.RawURLEncoding.Strict() в verifyToken.
+	idx := len(token) / 2
+	repl := byte('x')
+	if token[idx] == repl {
+		repl = 'y'
+	}
+	tampered := token[:idx] + string(repl) + token[idx+1:]
+	if tampered == token {
+		t.Fatal("tampering did not change the token")
+	}
+	if _, err = s.verifyToken(tampered, "1.2.3.4"); err != ErrInvalidToken {
+		t.Errorf("tampered token: err = %v, want ErrInvalidToken", err)
+	}
+
+	expired, err := s.Presign("prefix", "name.bin", -time.Second, WithClientIP("1.2.3.4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.verifyToken(expired, "1.2.3.4"); err != ErrTokenExpired {
+		t.Errorf("expired token: err = %v, want ErrTokenExpired", err)
+	}
+}
+
+// TestPresignKeyRotation проверяет сценарий ротации ключей из документации
+// SetSigningKey: токен, подписанный прежним ключом, остается действителен,
+// пока этот ключ еще принимается, и перестает проверяться после того, как
+// его окончательно убрали из списка.
+func TestPresignKeyRotation(t *testing.T) {
+	var s Store
+	s.SetSigningKey([]byte("old-key"))
+	token, err := s.Presign("", "name.bin", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetSigningKey([]byte("new-key"), []byte("old-key"))
+	if _, err = s.verifyToken(token, ""); err != nil {
+		t.Errorf("token signed with rotated-out key should still verify: %v", err)
+	}
+
+	s.SetSigningKey([]byte("new-key"))
+	if _, err = s.verifyToken(token, ""); err != ErrInvalidToken {
+		t.Errorf("token signed with a fully retired key: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+// TestPresignNoSigningKey проверяет, что Presign без SetSigningKey
+// возвращает ErrNoSigningKey, а не подписывает токен нулевым ключом.
+func TestPresignNoSigningKey(t *testing.T) {
+	var s Store
+	if _, err := s.Presign("", "name.bin", time.Hour); err != ErrNoSigningKey {
+		t.Errorf("err = %v, want ErrNoSigningKey", err)
+	}
+}
@@ -0,0 +1,61 @@
+package filestore
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ArchiveHandler возвращает обработчик HTTP-запросов вида
+// GET /archive/{prefix}?format=tar|zip, отдающий все файлы из {prefix} в
+// виде потокового tar- или zip-архива. archivePrefix - это префикс пути
+// запроса, предшествующий {prefix} (например, "/archive/"), который нужно
+// отрезать, чтобы получить сам префикс хранилища.
+//
+// В отличие от Get/Post, это обычный http.HandlerFunc, а не rest.Handler:
+// потоковая отдача архива без буферизации не укладывается в ответ
+// "структура в JSON", для которого рассчитан rest.Context.
+func (s *Store) ArchiveHandler(archivePrefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var prefix = strings.TrimPrefix(r.URL.Path, archivePrefix)
+		var format = ArchiveFormat(r.URL.Query().Get("format"))
+		var contentType, ext string
+		switch format {
+		case ArchiveZip:
+			contentType, ext = "application/zip", "zip"
+		default:
+			format, contentType, ext = ArchiveTar, "application/x-tar", "tar"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition",
+			`attachment; filename="`+path.Base(prefix)+"."+ext+`"`)
+		var aw = &archiveWriter{ResponseWriter: w}
+		if err := s.Archive(prefix, aw, format); err != nil {
+			if !aw.written {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// отдача архива уже началась (заголовки и часть тела отправлены
+			// клиенту) - полноценный Content-Length архиву в любом случае не
+			// предполагается, так что клиент получит лишь оборванный, заведомо
+			// невалидный файл; http.Error тут приведет только к
+			// "superfluous WriteHeader" и мусору в теле ответа
+			log.Printf("filestore: archive %q: %v", prefix, err)
+		}
+	}
+}
+
+// archiveWriter оборачивает http.ResponseWriter, запоминая, была ли уже
+// отправлена клиенту хотя бы часть тела ответа - это нужно ArchiveHandler,
+// чтобы не пытаться отдать http.Error после того, как потоковая отдача
+// архива уже началась.
+type archiveWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *archiveWriter) Write(p []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(p)
+}
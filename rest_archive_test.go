@@ -0,0 +1,79 @@
+package filestore
+
+import (
+	"archive/tar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestArchiveHandlerTar проверяет, что ArchiveHandler отдает корректные
+// заголовки Content-Type/Content-Disposition и валидный tar-поток.
+func TestArchiveHandlerTar(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Create("docs", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	var handler = s.ArchiveHandler("/archive/")
+	r := httptest.NewRequest("GET", "/archive/docs", nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-tar" {
+		t.Fatalf("Content-Type = %q, want application/x-tar", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "docs.tar") {
+		t.Fatalf("Content-Disposition = %q, want filename docs.tar", cd)
+	}
+
+	tr := tar.NewReader(w.Body)
+	if _, err = tr.Next(); err != nil {
+		t.Fatalf("tar.Next: %v", err)
+	}
+}
+
+// TestArchiveHandlerZip проверяет выбор zip-формата по query-параметру
+// format и соответствующие заголовки ответа.
+func TestArchiveHandlerZip(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Create("docs", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	var handler = s.ArchiveHandler("/archive/")
+	r := httptest.NewRequest("GET", "/archive/docs?format=zip", nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Fatalf("Content-Type = %q, want application/zip", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "docs.zip") {
+		t.Fatalf("Content-Disposition = %q, want filename docs.zip", cd)
+	}
+}
+
+// TestArchiveHandlerUnsupportedFormat проверяет, что неизвестный format
+// дает tar по умолчанию (см. ArchiveHandler), а не ошибку.
+func TestArchiveHandlerUnsupportedFormat(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var handler = s.ArchiveHandler("/archive/")
+	r := httptest.NewRequest("GET", "/archive/?format=rar", nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-tar" {
+		t.Fatalf("Content-Type = %q, want application/x-tar (формат по умолчанию)", ct)
+	}
+}
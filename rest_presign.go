@@ -0,0 +1,39 @@
+package filestore
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mdigger/rest"
+)
+
+// GetSigned отдает файл по подписанной ссылке, выданной Presign: проверяет
+// токен из query-параметра token и, если он действителен, отдает файл так
+// же, как обычный Get.
+func (s *Store) GetSigned(c *rest.Context) error {
+	var token = c.Request.URL.Query().Get("token")
+	claims, err := s.verifyToken(token, requestIP(c.Request))
+	if err != nil {
+		c.SetStatus(http.StatusForbidden)
+		return nil
+	}
+	file, err := s.Open(claims.Prefix, claims.Name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if claims.CD != "" {
+		c.SetHeader("Content-Disposition", claims.CD)
+	}
+	return c.ServeContent("", time.Time{}, file)
+}
+
+// requestIP возвращает IP-адрес клиента без порта.
+func requestIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,75 @@
+package filestore
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mdigger/rest"
+)
+
+// tusResumable - это версия протокола tus.io, семантике которой следует
+// данная реализация (creation + core).
+const tusResumable = "1.0.0"
+
+// PostUpload создает сессию возобновляемой загрузки файла длиной
+// Upload-Length байт и отдает ее адрес в заголовке Location, по аналогии с
+// tus.io creation extension.
+func (s *Store) PostUpload(c *rest.Context) error {
+	length, err := strconv.ParseInt(c.Request.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.SetStatus(http.StatusBadRequest)
+		return nil
+	}
+	upload, err := s.NewUpload("", length)
+	if err != nil {
+		return err
+	}
+	c.SetHeader("Tus-Resumable", tusResumable)
+	c.SetHeader("Location", path.Join(strings.TrimSuffix(c.Request.URL.Path, "/"), upload.ID))
+	c.SetStatus(http.StatusCreated)
+	return nil
+}
+
+// HeadUpload отдает текущее смещение незавершенной загрузки в заголовке
+// Upload-Offset.
+func (s *Store) HeadUpload(c *rest.Context) error {
+	upload, err := s.UploadStatus(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	c.SetHeader("Tus-Resumable", tusResumable)
+	c.SetHeader("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.SetHeader("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.SetStatus(http.StatusOK)
+	return nil
+}
+
+// PatchUpload дописывает очередную порцию данных к незавершенной загрузке,
+// начиная со смещения, заданного в заголовке Upload-Offset. Когда загрузка
+// завершена, в ответе дополнительно отдается Location сохраненного файла.
+func (s *Store) PatchUpload(c *rest.Context) error {
+	if c.Request.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		c.SetStatus(http.StatusUnsupportedMediaType)
+		return nil
+	}
+	offset, err := strconv.ParseInt(c.Request.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.SetStatus(http.StatusBadRequest)
+		return nil
+	}
+	var id = c.Param("id")
+	fi, newOffset, err := s.ResumeCreate(id, offset, c.Request.Body)
+	if err != nil {
+		return err
+	}
+	c.SetHeader("Tus-Resumable", tusResumable)
+	c.SetHeader("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	if fi != nil {
+		var dir = strings.TrimSuffix(c.Request.URL.Path, "/"+id)
+		c.SetHeader("Location", path.Join(dir, fi.Name))
+	}
+	c.SetStatus(http.StatusNoContent)
+	return nil
+}
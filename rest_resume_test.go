@@ -0,0 +1,92 @@
+package filestore
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mdigger/rest"
+)
+
+// newResumeMux собирает tus-style роутер поверх Store для тестов REST-слоя
+// возобновляемых загрузок.
+func newResumeMux(s *Store) *rest.ServeMux {
+	var mux = new(rest.ServeMux)
+	mux.Handle("POST", "/uploads", s.PostUpload)
+	mux.Handle("HEAD", "/uploads/:id", s.HeadUpload)
+	mux.Handle("PATCH", "/uploads/:id", s.PatchUpload)
+	return mux
+}
+
+// TestRestResumeUploadFlow проверяет полный цикл tus-style загрузки через
+// HTTP-обвязку: POST создает сессию и отдает Location, HEAD отдает текущий
+// Upload-Offset, а финальный PATCH возвращает Location сохраненного файла.
+func TestRestResumeUploadFlow(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := newResumeMux(s)
+
+	r := httptest.NewRequest("POST", "/uploads", nil)
+	r.Header.Set("Upload-Length", "11")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != 201 {
+		t.Fatalf("POST /uploads: code = %d, body = %s", w.Code, w.Body)
+	}
+	location := w.Header().Get("Location")
+	if location == "" {
+		t.Fatal("POST /uploads: пустой Location")
+	}
+
+	r = httptest.NewRequest("HEAD", location, nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	// rest.Context.Write(nil) понижает код ответа до 204, даже если
+	// хендлер явно выставил 200 - таково поведение всего пакета rest, не
+	// специфика HeadUpload.
+	if w.Code != 204 || w.Header().Get("Upload-Offset") != "0" {
+		t.Fatalf("HEAD %s: code=%d Upload-Offset=%q", location, w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	r = httptest.NewRequest("PATCH", location, strings.NewReader("hello world"))
+	r.Header.Set("Content-Type", "application/offset+octet-stream")
+	r.Header.Set("Upload-Offset", "0")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != 204 {
+		t.Fatalf("PATCH %s: code = %d, body = %s", location, w.Code, w.Body)
+	}
+	if w.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("Upload-Offset = %q, want 11", w.Header().Get("Upload-Offset"))
+	}
+	if w.Header().Get("Location") == "" {
+		t.Fatal("финальный PATCH не вернул Location сохраненного файла")
+	}
+}
+
+// TestRestResumePatchWrongOffset проверяет, что PATCH с несовпадающим
+// Upload-Offset отклоняется ошибкой, а не молча дописывает данные не туда.
+func TestRestResumePatchWrongOffset(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := newResumeMux(s)
+
+	up, err := s.NewUpload("", 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("PATCH", "/uploads/"+up.ID, strings.NewReader("world"))
+	r.Header.Set("Content-Type", "application/offset+octet-stream")
+	r.Header.Set("Upload-Offset", strconv.Itoa(6))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code == 204 {
+		t.Fatalf("PATCH с неверным Upload-Offset не должен завершаться успехом: body = %s", w.Body)
+	}
+}
@@ -0,0 +1,246 @@
+package filestore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrUploadOffsetMismatch возвращается ResumeCreate, если переданное
+// смещение не совпадает с реально накопленным - клиент должен повторить
+// запрос с правильным Upload-Offset (обычно узнанным через HEAD).
+var ErrUploadOffsetMismatch = errors.New("filestore: upload offset mismatch")
+
+// ErrUploadTooLarge возвращается ResumeCreate, если с учетом переданных
+// данных загрузка превысила объявленную при создании длину.
+var ErrUploadTooLarge = errors.New("filestore: upload exceeds declared length")
+
+// UploadInfo описывает состояние возобновляемой (resumable) загрузки файла,
+// ведущейся в несколько приемов через Store.ResumeCreate (см. также
+// rest.go - HTTP-обвязка поверх него в духе tus.io).
+type UploadInfo struct {
+	ID     string `json:"id"`
+	Length int64  `json:"length"`
+	Offset int64  `json:"offset"`
+}
+
+// uploadState - это то, что сохраняется на диске между вызовами
+// ResumeCreate: длина, на которую рассчитана загрузка, и фактически
+// накопленное смещение. Хеши содержимого на этом этапе не считаются - это
+// все равно пришлось бы делать заново при завершении загрузки, чтобы учесть
+// WithHashes/WithNameHash (см. ResumeCreate), так что промежуточное
+// состояние хранить незачем.
+type uploadState struct {
+	Prefix    string `json:"prefix"`
+	Filename  string `json:"filename,omitempty"`
+	DeleteKey string `json:"deleteKey,omitempty"`
+	Length    int64  `json:"length"`
+	Offset    int64  `json:"offset"`
+}
+
+// uploadDir возвращает каталог, в котором хранятся незавершенные загрузки.
+func (s *Store) uploadDir() string {
+	if s.uploadDirPath != "" {
+		return s.uploadDirPath
+	}
+	return os.TempDir()
+}
+
+func (s *Store) uploadDataPath(id string) string {
+	return filepath.Join(s.uploadDir(), id+".data")
+}
+
+func (s *Store) uploadStatePath(id string) string {
+	return filepath.Join(s.uploadDir(), id+".state")
+}
+
+// newUploadID генерирует случайный идентификатор возобновляемой загрузки.
+func newUploadID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+func (s *Store) loadUploadState(id string) (*uploadState, error) {
+	data, err := ioutil.ReadFile(s.uploadStatePath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var state uploadState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *Store) saveUploadState(id string, state *uploadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.uploadStatePath(id), data, 0600)
+}
+
+// NewUpload создает сессию возобновляемой загрузки для файла длиной length
+// байт и возвращает ее идентификатор. Пока загрузка не завершена, ее
+// содержимое никак не появляется в самом Store.
+func (s *Store) NewUpload(prefix string, length int64, opts ...CreateOption) (*UploadInfo, error) {
+	var o createOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(s.uploadDataPath(id), nil, 0600); err != nil {
+		return nil, err
+	}
+	var state = &uploadState{
+		Prefix:    prefix,
+		Filename:  o.filename,
+		DeleteKey: o.deleteKey,
+		Length:    length,
+	}
+	if err = s.saveUploadState(id, state); err != nil {
+		os.Remove(s.uploadDataPath(id))
+		return nil, err
+	}
+	return &UploadInfo{ID: id, Length: length}, nil
+}
+
+// UploadStatus возвращает текущее смещение незавершенной загрузки.
+func (s *Store) UploadStatus(id string) (*UploadInfo, error) {
+	state, err := s.loadUploadState(id)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadInfo{ID: id, Length: state.Length, Offset: state.Offset}, nil
+}
+
+// lockUpload возвращает функцию разблокировки мьютекса, закрепленного за
+// конкретной возобновляемой загрузкой id, создавая его при первом
+// обращении. В отличие от s.mu, который используется только для быстрой
+// read-modify-write метаданных блоба (см. commitStaged), этот мьютекс
+// удерживается на все время записи тела PATCH-запроса - но только для
+// данного id, так что параллельные загрузки с другими id друг друга не
+// ждут.
+//
+// Возвращаемая unlock принимает remove: когда загрузка завершена и больше
+// не понадобится, remove=true убирает запись мьютекса из uploadLocks, но
+// делает это уже ПОСЛЕ Unlock, а не вместо него - если убрать запись раньше
+// (как было до этой правки), повторный/дублирующий запрос с тем же id,
+// придя во время еще не закончившегося finalize, получит собственный,
+// несвязанный мьютекс и выполнится параллельно с ним.
+func (s *Store) lockUpload(id string) (unlock func(remove bool)) {
+	v, _ := s.uploadLocks.LoadOrStore(id, new(sync.Mutex))
+	var mu = v.(*sync.Mutex)
+	mu.Lock()
+	return func(remove bool) {
+		mu.Unlock()
+		if remove {
+			s.uploadLocks.Delete(id)
+		}
+	}
+}
+
+// ResumeCreate дописывает очередную порцию данных r к возобновляемой
+// загрузке id, начиная со смещения offset, и возвращает новое смещение.
+// Когда offset достигает общей длины, загрузка завершается: накопленные
+// данные размещаются в хранилище точно так же, как обычным Create (включая
+// WithHashes/WithNameHash), и возвращается итоговый FileInfo (до этого
+// момента fi == nil).
+func (s *Store) ResumeCreate(id string, offset int64, r io.Reader) (fi *FileInfo, newOffset int64, err error) {
+	var finished bool
+	unlock := s.lockUpload(id)
+	defer func() { unlock(finished) }()
+
+	state, err := s.loadUploadState(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset != state.Offset {
+		return nil, state.Offset, ErrUploadOffsetMismatch
+	}
+
+	var datapath = s.uploadDataPath(id)
+	data, err := os.OpenFile(datapath, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, state.Offset, err
+	}
+	n, err := io.Copy(data, r)
+	if cerr := data.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, state.Offset, err
+	}
+
+	if state.Offset+n > state.Length {
+		// Отбрасываем весь дописанный кусок целиком: иначе .data-файл
+		// остался бы длиннее того смещения, которое мы сообщаем через
+		// UploadStatus, и клиент, честно возобновивший загрузку с этого
+		// смещения, дописывал бы поверх уже лежащих там лишних байт.
+		// Откатываем файл к state.Offset, не трогая persisted-состояние -
+		// оно и так еще соответствует дооткатанному файлу.
+		if terr := os.Truncate(datapath, state.Offset); terr != nil {
+			return nil, state.Offset, terr
+		}
+		return nil, state.Offset, ErrUploadTooLarge
+	}
+	state.Offset += n
+
+	if state.Offset < state.Length {
+		if err = s.saveUploadState(id, state); err != nil {
+			return nil, state.Offset, err
+		}
+		return nil, state.Offset, nil
+	}
+
+	// загрузка завершена - размещаем накопленные данные в хранилище так же,
+	// как это делает обычный Create: stageFile читает тело файла и считает
+	// хеши без удержания s.mu, а commitStaged лишь ненадолго берет его для
+	// записи метаданных. Сохраняем финальный offset прежде, чем приступать
+	// к этому - если дублирующий PATCH все же проскочит мимо мьютекса (см.
+	// lockUpload) до того, как defer-ы ниже уберут state/data файлы, он
+	// увидит persisted offset == state.Length и получит
+	// ErrUploadOffsetMismatch, а не будет читать/обрезать datapath
+	// параллельно с еще не завершенным finalize; если же он опоздает и
+	// к этому моменту файлы уже убраны, получит ErrNotFound - оба исхода
+	// безопасны.
+	finished = true
+	if err = s.saveUploadState(id, state); err != nil {
+		return nil, state.Offset, err
+	}
+	defer os.Remove(datapath)
+	defer os.Remove(s.uploadStatePath(id))
+	file, err := os.Open(datapath)
+	if err != nil {
+		return nil, state.Offset, err
+	}
+	staged, err := s.stageFile(state.Prefix, file, createOptions{
+		filename:  state.Filename,
+		deleteKey: state.DeleteKey,
+	})
+	file.Close()
+	if err != nil {
+		return nil, state.Offset, err
+	}
+	defer staged.cleanup()
+	fi, err = s.commitStaged(staged)
+	if err != nil {
+		return nil, state.Offset, err
+	}
+	return fi, state.Offset, nil
+}
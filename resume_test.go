@@ -0,0 +1,141 @@
+package filestore
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestResumeCreateChunked проверяет базовый сценарий возобновляемой
+// загрузки в несколько приемов: офсеты продвигаются по мере дозаписи, а
+// итоговый FileInfo появляется только на чанке, которым достигается
+// заявленная длина.
+func TestResumeCreateChunked(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up, err := s.NewUpload("", 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up.Length != 11 || up.Offset != 0 {
+		t.Fatalf("up = %+v", up)
+	}
+
+	fi, offset, err := s.ResumeCreate(up.ID, 0, strings.NewReader("hello "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi != nil || offset != 6 {
+		t.Fatalf("после первого чанка: fi=%v offset=%d, want nil 6", fi, offset)
+	}
+	if status, err := s.UploadStatus(up.ID); err != nil || status.Offset != 6 {
+		t.Fatalf("UploadStatus = %+v, %v", status, err)
+	}
+
+	fi, offset, err = s.ResumeCreate(up.ID, 6, strings.NewReader("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi == nil || offset != 11 {
+		t.Fatalf("после финального чанка: fi=%v offset=%d, want non-nil 11", fi, offset)
+	}
+
+	rc, err := s.Open("", fi.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var buf = make([]byte, 32)
+	n, _ := rc.Read(buf)
+	if string(buf[:n]) != "hello world" {
+		t.Fatalf("content = %q, want %q", buf[:n], "hello world")
+	}
+}
+
+// TestResumeCreateOffsetMismatch проверяет, что PATCH с неверным смещением
+// отклоняется и сообщает реально накопленное смещение.
+func TestResumeCreateOffsetMismatch(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, err := s.NewUpload("", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset, err := s.ResumeCreate(up.ID, 3, strings.NewReader("hi")); err != ErrUploadOffsetMismatch || offset != 0 {
+		t.Fatalf("err = %v, offset = %d, want ErrUploadOffsetMismatch, 0", err, offset)
+	}
+}
+
+// TestResumeCreateDuplicateFinalPatch проверяет защиту от дублирующего
+// PATCH, завершающего уже завершенную загрузку (именно такой повтор
+// отправляют tus-клиенты, не увидевшие ответ на финальный запрос): к
+// моменту, когда дубликат доходит до loadUploadState, сессия уже убрана
+// (ErrNotFound), а не дописывает/обрезает поверх уже сохраненного файла.
+func TestResumeCreateDuplicateFinalPatch(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, err := s.NewUpload("", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, _, err := s.ResumeCreate(up.ID, 0, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// повторный (дублирующий) PATCH с тем же исходным offset=0 не должен
+	// ни преуспеть, ни повредить уже сохраненный файл
+	if _, _, err = s.ResumeCreate(up.ID, 0, strings.NewReader("world")); err != ErrNotFound {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+
+	rc, err := s.Open("", fi.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var buf = make([]byte, 32)
+	n, _ := rc.Read(buf)
+	if string(buf[:n]) != "hello" {
+		t.Fatalf("content = %q, want %q (не должен быть поврежден дублирующим PATCH)", buf[:n], "hello")
+	}
+}
+
+// TestLockUploadHeldThroughUnlock проверяет, что lockUpload/unlock не дают
+// двум вызовам для одного и того же id выполняться параллельно: запись в
+// uploadLocks должна исчезать только после Unlock, а не раньше. Раньше
+// finalize в ResumeCreate вызывал uploadLocks.Delete, пока мьютекс еще был
+// захвачен, так что конкурентный вызов с тем же id получал совсем другой,
+// незахваченный мьютекс и не ждал вовсе.
+func TestLockUploadHeldThroughUnlock(t *testing.T) {
+	var s Store
+	unlock := s.lockUpload("upload-id")
+
+	var acquired = make(chan struct{})
+	go func() {
+		u2 := s.lockUpload("upload-id")
+		close(acquired)
+		u2(true)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("конкурентный lockUpload получил мьютекс, пока первый еще держит его")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock(true)
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("конкурентный lockUpload не получил мьютекс после unlock(true)")
+	}
+}
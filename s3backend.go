@@ -0,0 +1,291 @@
+package filestore
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Backend реализует Backend поверх любого S3-совместимого объектного
+// хранилища. Используется та же раскладка ключей, что и в localBackend
+// (name[:1]/name[1:3]/name[3:]), так что перейти с локального хранилища на
+// объектное можно без изменения хеш-имен уже сохраненных файлов.
+type S3Backend struct {
+	Endpoint  string // адрес сервера, например "https://s3.example.com"
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+// NewS3Backend возвращает драйвер Backend для S3-совместимого хранилища.
+func NewS3Backend(endpoint, bucket, region, accessKey, secretKey string) *S3Backend {
+	return &S3Backend{
+		Endpoint:  strings.TrimRight(endpoint, "/"),
+		Bucket:    bucket,
+		Region:    region,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Client:    http.DefaultClient,
+	}
+}
+
+// objectURL возвращает URL объекта с заданным ключом (path-style адресация).
+func (b *S3Backend) objectURL(key string) string {
+	return fmt.Sprintf("%s/%s/%s", b.Endpoint, b.Bucket, (&url.URL{Path: key}).EscapedPath())
+}
+
+// Put сохраняет содержимое r по указанному ключу одним PUT-запросом.
+func (b *S3Backend) Put(key string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, b.objectURL(key), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if err = b.sign(req, data); err != nil {
+		return err
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return b.statusError("put", key, resp)
+	}
+	return nil
+}
+
+// s3object - это буферизованное в памяти содержимое объекта, реализующее
+// io.ReadSeekCloser, т.к. http.Response.Body сам по себе не умеет Seek.
+type s3object struct {
+	*bytes.Reader
+}
+
+func (s3object) Close() error { return nil }
+
+// Open загружает содержимое объекта по ключу и возвращает его как
+// io.ReadSeekCloser.
+func (b *S3Backend) Open(key string) (io.ReadSeekCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, b.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = b.sign(req, nil); err != nil {
+		return nil, err
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, b.statusError("get", key, resp)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return s3object{bytes.NewReader(data)}, nil
+}
+
+// Stat возвращает информацию об объекте по ключу (HEAD-запрос).
+func (b *S3Backend) Stat(key string) (os.FileInfo, error) {
+	req, err := http.NewRequest(http.MethodHead, b.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = b.sign(req, nil); err != nil {
+		return nil, err
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, b.statusError("stat", key, resp)
+	}
+	var size, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	var modtime, _ = time.Parse(http.TimeFormat, resp.Header.Get("Last-Modified"))
+	return &s3FileInfo{name: key, size: size, modtime: modtime}, nil
+}
+
+// objectContentType запрашивает HEAD объекта и возвращает его текущий
+// Content-Type. Ошибки игнорируются (возвращается пустая строка) - вызывается
+// только как вспомогательный шаг SetModTime, не обязанный быть надежнее самой
+// операции копирования.
+func (b *S3Backend) objectContentType(key string) string {
+	req, err := http.NewRequest(http.MethodHead, b.objectURL(key), nil)
+	if err != nil {
+		return ""
+	}
+	if err = b.sign(req, nil); err != nil {
+		return ""
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	return resp.Header.Get("Content-Type")
+}
+
+// SetModTime обновляет время модификации объекта. S3 не позволяет менять
+// метаданные объекта на месте, поэтому используется copy-object самого в
+// себя - это обновляет Last-Modified без изменения содержимого. t игнорируется:
+// реальное API не дает выставить Last-Modified произвольным значением, сервер
+// всегда проставляет текущее время copy-запроса.
+//
+// Self-copy у S3 обязательно требует x-amz-metadata-directive: REPLACE (без
+// него сервер отклоняет запрос как бессмысленный), а REPLACE без явного
+// Content-Type сбросил бы его на значение по умолчанию - поэтому сначала
+// запросом HEAD узнаем текущий Content-Type объекта и передаем его обратно в
+// запросе копирования. Это best-effort операция: на случай гонки с
+// одновременной заменой содержимого того же ключа ошибку HEAD не считаем
+// фатальной для остальных метаданных - Content-Type в таком случае просто не
+// передается, и поведение сводится к прежнему (но REPLACE все равно нужен).
+func (b *S3Backend) SetModTime(key string, t time.Time) error {
+	var contentType = b.objectContentType(key)
+
+	req, err := http.NewRequest(http.MethodPut, b.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-amz-copy-source", "/"+b.Bucket+"/"+key)
+	req.Header.Set("x-amz-metadata-directive", "REPLACE")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if err = b.sign(req, nil); err != nil {
+		return err
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return b.statusError("copy", key, resp)
+	}
+	return nil
+}
+
+// Remove удаляет объект по ключу.
+func (b *S3Backend) Remove(key string) error {
+	req, err := http.NewRequest(http.MethodDelete, b.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	if err = b.sign(req, nil); err != nil {
+		return err
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return b.statusError("delete", key, resp)
+	}
+	return nil
+}
+
+// listResult - это минимальный набор полей, нужных для разбора ответа
+// ListObjectsV2.
+type listResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// Walk обходит все объекты бакета через постраничный ListObjectsV2.
+func (b *S3Backend) Walk(fn func(key string, info os.FileInfo) error) error {
+	var token string
+	for {
+		var query = url.Values{"list-type": {"2"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := http.NewRequest(http.MethodGet,
+			fmt.Sprintf("%s/%s?%s", b.Endpoint, b.Bucket, query.Encode()), nil)
+		if err != nil {
+			return err
+		}
+		if err = b.sign(req, nil); err != nil {
+			return err
+		}
+		resp, err := b.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = b.statusError("list", b.Bucket, resp)
+			resp.Body.Close()
+			return err
+		}
+		var list listResult
+		err = xml.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, item := range list.Contents {
+			var modtime, _ = time.Parse(time.RFC3339, item.LastModified)
+			var info = &s3FileInfo{name: item.Key, size: item.Size, modtime: modtime}
+			if err = fn(item.Key, info); err != nil {
+				return err
+			}
+		}
+		if !list.IsTruncated {
+			return nil
+		}
+		token = list.NextContinuationToken
+	}
+}
+
+// statusError формирует ошибку на основании неожиданного ответа сервера.
+func (b *S3Backend) statusError(op, key string, resp *http.Response) error {
+	return &os.PathError{Op: op, Path: key,
+		Err: fmt.Errorf("s3: unexpected status %s", resp.Status)}
+}
+
+// s3FileInfo - это минимальная реализация os.FileInfo для объектов S3.
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modtime time.Time
+}
+
+func (fi *s3FileInfo) Name() string       { return fi.name }
+func (fi *s3FileInfo) Size() int64        { return fi.size }
+func (fi *s3FileInfo) Mode() os.FileMode  { return 0644 }
+func (fi *s3FileInfo) ModTime() time.Time { return fi.modtime }
+func (fi *s3FileInfo) IsDir() bool        { return false }
+func (fi *s3FileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,90 @@
+package filestore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sign подписывает запрос по алгоритму AWS Signature Version 4. payload
+// может быть nil (для запросов без тела).
+func (b *S3Backend) sign(req *http.Request, payload []byte) error {
+	var now = time.Now().UTC()
+	var amzDate = now.Format("20060102T150405Z")
+	var dateStamp = now.Format("20060102")
+	var payloadHash = hashHex(payload)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	var signedHeaders, canonicalHeaders = canonicalHeaders(req)
+	var canonicalRequest = strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	var scope = dateStamp + "/" + b.Region + "/s3/aws4_request"
+	var stringToSign = strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	var signingKey = hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256(
+		[]byte("AWS4"+b.SecretKey), dateStamp), b.Region), "s3"), "aws4_request")
+	var signature = hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 "+
+		"Credential="+b.AccessKey+"/"+scope+", "+
+		"SignedHeaders="+signedHeaders+", "+
+		"Signature="+signature)
+	return nil
+}
+
+// canonicalHeaders возвращает список подписанных заголовков и их
+// каноническое представление, как того требует SigV4.
+func canonicalHeaders(req *http.Request) (signedHeaders, canonical string) {
+	var names = []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("x-amz-copy-source") != "" {
+		names = append(names, "x-amz-copy-source")
+	}
+	if req.Header.Get("x-amz-metadata-directive") != "" {
+		names = append(names, "x-amz-metadata-directive")
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		var value string
+		if name == "host" {
+			value = req.Host
+		} else {
+			value = req.Header.Get(name)
+		}
+		lines = append(lines, name+":"+strings.TrimSpace(value))
+	}
+	return strings.Join(names, ";"), strings.Join(lines, "\n") + "\n"
+}
+
+func hashHex(data []byte) string {
+	var sum = sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	var h = hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
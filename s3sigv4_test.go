@@ -0,0 +1,73 @@
+package filestore
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestHashHex проверяет хеш пустого тела запроса - значение, которое S3
+// ожидает в x-amz-content-sha256 для запросов без payload.
+func TestHashHex(t *testing.T) {
+	const want = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if got := hashHex(nil); got != want {
+		t.Errorf("hashHex(nil) = %s, want %s", got, want)
+	}
+}
+
+// TestDeriveSigningKey проверяет цепочку HMAC-SHA256, которой sign()
+// получает ключ подписи SigV4 (kDate -> kRegion -> kService -> kSigning), на
+// тестовых учетных данных из документации AWS по Signature Version 4.
+func TestDeriveSigningKey(t *testing.T) {
+	const (
+		secretKey = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+		dateStamp = "20150830"
+		region    = "us-east-1"
+		service   = "s3"
+		want      = "61c08448a068b7aaaa3bd62d8e7b3c83b7982fcb0cae7650b7334230c1e715b6"
+	)
+	var signingKey = hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256(
+		[]byte("AWS4"+secretKey), dateStamp), region), service), "aws4_request")
+	if got := hex.EncodeToString(signingKey); got != want {
+		t.Errorf("signing key = %s, want %s", got, want)
+	}
+}
+
+// TestCanonicalHeaders проверяет, что canonicalHeaders всегда подписывает
+// host, x-amz-content-sha256 и x-amz-date (в алфавитном порядке), и
+// дополнительно x-amz-copy-source/x-amz-metadata-directive, если они заданы
+// (см. SetModTime).
+func TestCanonicalHeaders(t *testing.T) {
+	req := &http.Request{
+		Host:   "examplebucket.s3.amazonaws.com",
+		URL:    &url.URL{},
+		Header: http.Header{},
+	}
+	req.Header.Set("x-amz-content-sha256", "UNSIGNED-PAYLOAD")
+	req.Header.Set("x-amz-date", "20150830T123600Z")
+
+	signedHeaders, canonical := canonicalHeaders(req)
+	const wantSigned = "host;x-amz-content-sha256;x-amz-date"
+	if signedHeaders != wantSigned {
+		t.Errorf("signedHeaders = %q, want %q", signedHeaders, wantSigned)
+	}
+	const wantCanonical = "host:examplebucket.s3.amazonaws.com\n" +
+		"x-amz-content-sha256:UNSIGNED-PAYLOAD\n" +
+		"x-amz-date:20150830T123600Z\n"
+	if canonical != wantCanonical {
+		t.Errorf("canonical headers = %q, want %q", canonical, wantCanonical)
+	}
+
+	req.Header.Set("x-amz-copy-source", "/bucket/key")
+	req.Header.Set("x-amz-metadata-directive", "REPLACE")
+	signedHeaders, canonical = canonicalHeaders(req)
+	const wantSignedWithCopy = "host;x-amz-content-sha256;x-amz-copy-source;x-amz-date;x-amz-metadata-directive"
+	if signedHeaders != wantSignedWithCopy {
+		t.Errorf("signedHeaders = %q, want %q", signedHeaders, wantSignedWithCopy)
+	}
+	if !strings.Contains(canonical, "x-amz-copy-source:/bucket/key\n") {
+		t.Errorf("canonical headers missing x-amz-copy-source: %q", canonical)
+	}
+}
@@ -5,27 +5,60 @@ import (
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/hex"
+	"hash"
 	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
-// Store описывает хранилище файлов.
+// Store - это тонкая обвязка над Backend, которая занимается вычислением
+// хеш-имен файлов и раскладкой их по хранилищу. Вся работа с самими
+// данными (запись, чтение, удаление, обход) делегируется Backend.
 type Store struct {
-	root string
+	backend Backend
+	mu      sync.Mutex // защищает чтение-изменение-запись метаданных блоба
+
+	hashes   []HashAlgo      // дополнительные хеши, считаемые при Create
+	nameHash *nameHashConfig // алгоритм получения хеш-имени, если не crc32|md5
+
+	uploadDirPath string   // каталог для незавершенных возобновляемых загрузок (см. resume.go)
+	uploadLocks   sync.Map // per-upload мьютексы, см. lockUpload в resume.go
+
+	signingKeys [][]byte // ключи подписи ссылок, см. SetSigningKey в presign.go
+}
+
+// WithUploadDir задает каталог, в котором хранятся незавершенные
+// возобновляемые загрузки (см. Store.NewUpload/ResumeCreate в resume.go).
+// По умолчанию используется os.TempDir().
+func WithUploadDir(dir string) StoreOption {
+	return func(s *Store) { s.uploadDirPath = dir }
 }
 
-// Open открывает и возвращает хранилище файлов.
-func Open(root string) (*Store, error) {
-	// создаем каталог, если он еще не создан
-	if err := os.MkdirAll(root, 0700); err != nil {
+// Open открывает и возвращает хранилище файлов на локальной файловой
+// системе с корневым каталогом root.
+func Open(root string, opts ...StoreOption) (*Store, error) {
+	backend, err := newLocalBackend(root)
+	if err != nil {
 		return nil, err
 	}
-	return &Store{root: root}, nil
+	return OpenBackend(backend, opts...), nil
+}
+
+// OpenBackend возвращает хранилище файлов, использующее произвольный
+// Backend. Позволяет подключать альтернативные хранилища (например, S3)
+// вместо локальной файловой системы.
+func OpenBackend(b Backend, opts ...StoreOption) *Store {
+	var s = &Store{backend: b}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // FileInfo описывает информацию о сохраненном файле.
@@ -35,173 +68,359 @@ type FileInfo struct {
 	Size     int64  `json:"size"`
 	CRC32    uint32 `json:"crc32"`
 	MD5      string `json:"md5"`
+	// Hashes содержит дополнительные контрольные суммы, запрошенные через
+	// WithHashes. Для каждого файла считается за один проход вместе с
+	// CRC32/MD5.
+	Hashes map[HashAlgo]string `json:"hashes,omitempty"`
+}
+
+// key возвращает ключ Backend-а для файла с данным хеш-именем в указанном
+// prefix.
+func key(prefix, name string) string {
+	return filepath.Join(prefix, name[:1], name[1:3], name[3:])
+}
+
+// CreateOption задает дополнительные параметры при сохранении файла в
+// Create.
+type CreateOption func(*createOptions)
+
+type createOptions struct {
+	filename  string
+	deleteKey string
+}
+
+// WithFilename сохраняет в метаданных блоба исходное имя загружаемого файла.
+func WithFilename(name string) CreateOption {
+	return func(o *createOptions) { o.filename = name }
+}
+
+// WithDeleteKey задает ключ удаления для данной загрузки: Remove потребует
+// предъявления совпадающего ключа, пока хотя бы одна загрузка блоба задала
+// его при сохранении (по аналогии с linx-server).
+func WithDeleteKey(deleteKey string) CreateOption {
+	return func(o *createOptions) { o.deleteKey = deleteKey }
 }
 
 // Create сохраняет файл в хранилище. В качестве имени файла используется
 // комбинация из двух хешей. Файл сохраняется в подкаталоге prefix, если он
 // задан, но данный prefix не учитывается в возвращаемой информации в имени
-// файла.
-func (s *Store) Create(prefix string, r io.Reader) (*FileInfo, error) {
-	var root = filepath.Join(s.root, prefix) // добавляем префикс к корню
-	if err := os.MkdirAll(root, 0700); err != nil {
+// файла. Если файл с таким же содержимым уже есть в хранилище, физически
+// он не дублируется - вместо этого увеличивается счетчик ссылок на него в
+// метаданных блоба (см. Meta).
+func (s *Store) Create(prefix string, r io.Reader, opts ...CreateOption) (*FileInfo, error) {
+	var o createOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	staged, err := s.stageFile(prefix, r, o)
+	if err != nil {
 		return nil, err
 	}
-	// создаем временный файл в корневом каталоге
-	tmpfile, err := ioutil.TempFile(root, "~tmp")
+	defer staged.cleanup()
+	return s.commitStaged(staged)
+}
+
+// stagedFile - результат буферизации и хеширования содержимого файла,
+// подготовленный stageFile и еще не записанный в Backend, см. commitStaged.
+type stagedFile struct {
+	tmp     *os.File
+	fi      *FileInfo
+	fkey    string
+	metaKey string
+	upload  Upload
+}
+
+// cleanup закрывает и удаляет временный файл staged-а. Вызывается и при
+// ошибке stageFile/commitStaged, и после успешного завершения Create.
+func (sf *stagedFile) cleanup() {
+	sf.tmp.Close()
+	os.Remove(sf.tmp.Name())
+}
+
+// stageFile буферизует содержимое r во временном файле, попутно вычисляя
+// crc32/md5 и, если запрошены, дополнительные хеши из s.hashes/s.nameHash -
+// все за один проход. Итоговый ключ в Backend зависит от хешей, поэтому
+// писать напрямую в хранилище, пока они не посчитаны, нельзя. В отличие от
+// commitStaged, эта функция не требует s.mu: она только читает тело запроса
+// и пишет во временный файл, так что параллельные загрузки не блокируют
+// друг друга.
+func (s *Store) stageFile(prefix string, r io.Reader, o createOptions) (*stagedFile, error) {
+	tmpfile, err := ioutil.TempFile("", "filestore-")
 	if err != nil {
 		err.(*os.PathError).Path = tmpfileName // подменяем имя файла
 		return nil, err
 	}
-	// в любом случае временный файл должен быть удален, если он не был
-	// переименован, т.е. на момент окончания функции существует под временным
-	// именем
-	defer os.Remove(tmpfile.Name())
+	var staged = &stagedFile{tmp: tmpfile}
+	var ok bool
+	defer func() {
+		if !ok {
+			staged.cleanup()
+		}
+	}()
 
 	// копируем содержимое во временный файл
 	var bufferReader = bufio.NewReaderSize(r, 4<<10)
 	// пытаемся определить тип содержимого
 	data, err := bufferReader.Peek(512) // читаем первые 512 байт файла
 	if err != nil && err != io.EOF {
-		tmpfile.Close()
 		err = &os.PathError{Op: "create", Path: tmpfileName, Err: err}
 		return nil, err
 	}
 	var mimetype = http.DetectContentType(data) // определяем тип содержимого
-	// одновременно с сохранением в файл считаем две хеш-суммы
-	var crc32, md5 = crc32.NewIEEE(), md5.New()
-	size, err := bufferReader.WriteTo(io.MultiWriter(tmpfile, crc32, md5))
+	var crc32sum, md5sum = crc32.NewIEEE(), md5.New()
+	var writers = []io.Writer{tmpfile, crc32sum, md5sum}
+	var extra = make(map[HashAlgo]hash.Hash, len(s.hashes))
+	for _, algo := range s.hashes {
+		if _, ok := extra[algo]; ok {
+			continue // алгоритм уже добавлен
+		}
+		if h := newHash(algo); h != nil {
+			extra[algo] = h
+			writers = append(writers, h)
+		}
+	}
+	var nameHasher hash.Hash
+	if s.nameHash != nil {
+		if h, ok := extra[s.nameHash.algo]; ok {
+			nameHasher = h
+		} else {
+			nameHasher = newHash(s.nameHash.algo)
+			writers = append(writers, nameHasher)
+		}
+	}
+	size, err := bufferReader.WriteTo(io.MultiWriter(writers...))
 	if err != nil {
-		tmpfile.Close()
 		err = &os.PathError{Op: "write", Path: tmpfileName, Err: err}
 		return nil, err
 	}
 	// формируем информацию о файле
-	data = md5.Sum(nil)
-	var fi = &FileInfo{
-		Name: base64.RawURLEncoding.EncodeToString(
-			append(crc32.Sum(nil), data...)),
+	data = md5sum.Sum(nil)
+	var name string
+	if nameHasher != nil {
+		name = base64.RawURLEncoding.EncodeToString(
+			truncateSum(nameHasher.Sum(nil), s.nameHash.size))
+	} else {
+		name = base64.RawURLEncoding.EncodeToString(append(crc32sum.Sum(nil), data...))
+	}
+	var digests map[HashAlgo]string
+	if len(extra) > 0 {
+		digests = make(map[HashAlgo]string, len(extra))
+		for algo, h := range extra {
+			digests[algo] = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+	staged.fi = &FileInfo{
+		Name:     name,
 		Mimetype: mimetype,
 		Size:     size,
-		CRC32:    crc32.Sum32(),
+		CRC32:    crc32sum.Sum32(),
 		MD5:      hex.EncodeToString(data),
+		Hashes:   digests,
 	}
-	// закрываем временный файл
-	if err = tmpfile.Close(); err != nil {
-		if e, ok := err.(*os.PathError); ok {
-			e.Path = tmpfileName
+	staged.fkey = key(prefix, staged.fi.Name)
+	staged.metaKey = staged.fkey + metaSuffix
+	staged.upload = Upload{
+		Filename:  o.filename,
+		Mimetype:  staged.fi.Mimetype,
+		DeleteKey: o.deleteKey,
+	}
+	ok = true
+	return staged, nil
+}
+
+// commitStaged записывает результат stageFile в Backend. Если блоб с таким
+// же содержимым уже сохранен, временный файл никуда не копируется - вместо
+// этого под s.mu увеличивается счетчик ссылок в его метаданных. Это
+// единственная часть Create, требующая блокировки: она быстрая и не
+// зависит от размера файла, в отличие от буферизации и хеширования в
+// stageFile, поэтому параллельные загрузки по-прежнему не сериализуются.
+func (s *Store) commitStaged(staged *stagedFile) (*FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var now = time.Now()
+	staged.upload.Created = now
+
+	// если метаданные для такого блоба уже есть, значит содержимое уже
+	// сохранено - просто добавляем ссылку на него
+	if meta, err := loadMeta(s.backend, staged.metaKey); err == nil {
+		meta.RefCount++
+		meta.Uploads = append(meta.Uploads, staged.upload)
+		meta.Accessed = now
+		if err = saveMeta(s.backend, staged.metaKey, meta); err != nil {
+			return nil, err
 		}
+		if err = s.backend.SetModTime(staged.fkey, now); err != nil {
+			return nil, err
+		}
+		return staged.fi, nil
+	}
+	// перемещаемся в начало временного файла, чтобы передать его содержимое
+	// в Backend
+	if _, err := staged.tmp.Seek(0, io.SeekStart); err != nil {
 		return nil, err
 	}
-	// объединяем имя файла с корневым каталогом
-	var name = filepath.Join(root, fi.Name[:1], fi.Name[1:3], fi.Name[3:])
-	// если файл уже существует, то просто обновляем его время создания
-	var now = time.Now()
-	if err = os.Chtimes(name, now, now); err == nil {
-		// возвращаем информацию о файле, временный файл будет автоматически
-		// удален
-		return fi, nil
-	}
-	// если такого файла нет, то создаем для него каталог
-	if err = os.MkdirAll(filepath.Dir(name), 0700); err != nil {
-		err.(*os.PathError).Path = fi.Name
+	if err := s.backend.Put(staged.fkey, staged.tmp); err != nil {
 		return nil, err
 	}
-	// перемещаем временный файл в этот каталог
-	if err = os.Rename(tmpfile.Name(), name); err != nil {
-		err.(*os.PathError).Path = fi.Name
+	var meta = &Meta{RefCount: 1, Uploads: []Upload{staged.upload}, Accessed: now}
+	if err := saveMeta(s.backend, staged.metaKey, meta); err != nil {
 		return nil, err
 	}
 	// возвращаем информацию о созданном файле
-	return fi, nil
+	return staged.fi, nil
 }
 
 // tmpfileName используется в качестве имени временного файла при генериции
 // ошибок
 const tmpfileName = "<temporary file>"
 
+// defaultNameLen - длина хеш-имени, получаемого связкой crc32|md5 по
+// умолчанию (см. stageFile). Используется minNameLen, пока не задан
+// WithNameHash.
+const defaultNameLen = 27
+
+// minNameLen возвращает минимально допустимую длину хеш-имени файла - так
+// Open/Stat/Remove/Verify отсекают заведомо некорректные имена, не обращаясь
+// к Backend. Если задан WithNameHash, длина зависит от его алгоритма и
+// усечения, иначе используется длина имени по умолчанию (crc32|md5).
+func (s *Store) minNameLen() int {
+	if s.nameHash != nil {
+		return s.nameHash.encodedLen()
+	}
+	return defaultNameLen
+}
+
 // Open открывает файл из каталога.
-func (s *Store) Open(prefix, name string) (*os.File, error) {
-	if len(name) < 27 {
+func (s *Store) Open(prefix, name string) (io.ReadSeekCloser, error) {
+	if len(name) < s.minNameLen() {
 		return nil, ErrNotFound
 	}
-	// полное имя для доступа к файлу
-	var fullName = filepath.Join(s.root, prefix, name[:1], name[1:3], name[3:])
-	file, err := os.Open(fullName) // открываем файл
+	file, err := s.backend.Open(key(prefix, name))
 	if err != nil {
-		err.(*os.PathError).Path = name
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		if e, ok := err.(*os.PathError); ok {
+			e.Path = name
+		}
 		return nil, err
 	}
-	// получаем информацю о нем и проверяем, что это не каталог
-	fi, err := file.Stat()
+	// обновляем время доступа к файлу, но только если это дешево для данного
+	// бэкенда (см. cheapModTimeBackend) - для объектных хранилищ вроде S3
+	// SetModTime стоит полноценного запроса к серверу, и делать его на каждое
+	// чтение неприемлемо
+	if _, ok := s.backend.(cheapModTimeBackend); ok {
+		s.backend.SetModTime(key(prefix, name), time.Now())
+	}
+	return file, nil
+}
+
+// Stat возвращает метаданные сохраненного блоба: число логических ссылок
+// на него, сведения о загрузках и время последнего обращения.
+func (s *Store) Stat(prefix, name string) (*Meta, error) {
+	if len(name) < s.minNameLen() {
+		return nil, ErrNotFound
+	}
+	meta, err := loadMeta(s.backend, key(prefix, name)+metaSuffix)
 	if err != nil {
-		file.Close()
-		err.(*os.PathError).Path = name
+		if isNotExist(err) {
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
-	// возвращаем ошибку, если это каталог, а не файл
-	if fi.IsDir() {
-		file.Close()
-		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
-	}
-	// обновляем время доступа к файлу
-	var now = time.Now()
-	os.Chtimes(fullName, now, now)
-	return file, nil // возвращаем открытый файл
+	return meta, nil
 }
 
-// Remove удаляет файл из хранилища.
-func (s *Store) Remove(prefix, name string) error {
-	if len(name) < 27 {
+// Remove удаляет ссылку на файл из хранилища. Если на блоб ссылаются другие
+// загрузки (RefCount > 1), физически файл не удаляется - уменьшается
+// только счетчик ссылок. Если хотя бы одна из загрузок блоба была сделана с
+// DeleteKey, deleteKey должен совпадать с одним из них, иначе возвращается
+// ErrInvalidDeleteKey.
+func (s *Store) Remove(prefix, name, deleteKey string) error {
+	if len(name) < s.minNameLen() {
 		return ErrNotFound
 	}
-	var fullName = filepath.Join(s.root, prefix, name[:1], name[1:3], name[3:])
-	if err := os.Remove(fullName); err != nil {
-		err.(*os.PathError).Path = name
+	var fkey = key(prefix, name)
+	var metaKey = fkey + metaSuffix
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meta, err := loadMeta(s.backend, metaKey)
+	if err != nil {
+		if isNotExist(err) {
+			return ErrNotFound
+		}
 		return err
 	}
-	// пытаемся удалить пустые каталоги, если они образовались
-	for i := 0; i < 2; i++ {
-		fullName = filepath.Dir(fullName)
-		if err := os.Remove(fullName); err != nil {
-			break // если не получилось, значит каталог не пустой
+	// если хотя бы одна загрузка защищена ключом удаления, требуем, чтобы
+	// переданный ключ совпадал с одной из них
+	var hasDeleteKeys bool
+	var matched = -1
+	for i, u := range meta.Uploads {
+		if u.DeleteKey == "" {
+			continue
+		}
+		hasDeleteKeys = true
+		if u.DeleteKey == deleteKey {
+			matched = i
+			break
 		}
 	}
-	return nil
+	switch {
+	case hasDeleteKeys && matched < 0:
+		return ErrInvalidDeleteKey
+	case matched >= 0:
+		meta.Uploads = append(meta.Uploads[:matched], meta.Uploads[matched+1:]...)
+	case len(meta.Uploads) > 0:
+		meta.Uploads = meta.Uploads[1:]
+	}
+	meta.RefCount--
+	if meta.RefCount > 0 {
+		return saveMeta(s.backend, metaKey, meta)
+	}
+	// последняя ссылка снята - удаляем сам блоб и его метаданные. Порядок
+	// как в Clean: сначала содержимое. Если мы удалим metaKey первым и
+	// Remove(fkey) после этого упадет (например, на S3 это реальный,
+	// транзиентный случай), на диске останется metaKey с RefCount уже 0
+	// при живом blob'е - следующий Create с тем же содержимым попадет в
+	// dedup-путь commitStaged, решит, что blob уже на месте, и будет
+	// падать на SetModTime, потому что его там на самом деле нет. Удаляя
+	// содержимое первым, мы рискуем максимум осиротевшим metaKey, который
+	// безвреден и подчищается Clean.
+	if err = s.backend.Remove(fkey); err != nil {
+		if isNotExist(err) {
+			return ErrNotFound
+		}
+		if e, ok := err.(*os.PathError); ok {
+			e.Path = name
+		}
+		return err
+	}
+	return s.backend.Remove(metaKey)
 }
 
-// Clean удаляет старые файлы, к которым не обращались больше заданного времени.
+// Clean удаляет старые файлы, к которым не обращались больше заданного
+// времени. Блобы, на которые по-прежнему ссылается больше одной загрузки
+// (RefCount > 1), не удаляются, даже если формально устарели.
 func (s *Store) Clean(lifetime time.Duration) error {
-	// удаляем вообще все файлы, если время жизни не задано
-	if lifetime <= 0 {
-		return os.RemoveAll(s.root)
-	}
-	// вычисляем крайнюю дату валидности файлов
-	var valid = time.Now().Add(-lifetime)
-	var err = filepath.Walk(s.root,
-		func(filename string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			// не удаляем каталоги и новые файлы
-			if info.IsDir() || info.ModTime().After(valid) {
-				return nil
-			}
-			// удаляем старый файл
-			if err = os.Remove(filename); err != nil {
-				return nil // ошибку удаления игнорируем
-			}
-			// log.Debug("old file deleted", "filename", filename)
-			// пытаемся удалить пустые каталоги
-			for i := 0; i < 2; i++ {
-				filename = filepath.Dir(filename)
-				if err = os.Remove(filename); err != nil {
-					break // каталог не пустой
-				}
-			}
+	var valid = time.Now().Add(-lifetime) // крайняя дата валидности файлов
+	return s.backend.Walk(func(k string, info os.FileInfo) error {
+		// метафайлы удаляются вместе с блобом, которому они принадлежат
+		if strings.HasSuffix(k, metaSuffix) {
 			return nil
-		})
-	if os.IsNotExist(err) {
-		return nil // игнорируем ошибку, что файл не существует
-	}
-	return err
+		}
+		// не удаляем новые файлы, если время жизни задано
+		if lifetime > 0 && info.ModTime().After(valid) {
+			return nil
+		}
+		if meta, err := loadMeta(s.backend, k+metaSuffix); err == nil && meta.RefCount > 1 {
+			return nil // на блоб остались другие ссылки
+		}
+		// удаляем старый файл и его метаданные, ошибки удаления игнорируем
+		s.backend.Remove(k)
+		s.backend.Remove(k + metaSuffix)
+		return nil
+	})
 }
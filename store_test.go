@@ -0,0 +1,84 @@
+package filestore
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCreateDedupRefCount проверяет, что повторное сохранение одинакового
+// содержимого не дублирует блоб физически, а увеличивает счетчик ссылок на
+// него, и что Remove снимает ссылки по одной, удаляя сам блоб только когда
+// счетчик доходит до нуля.
+func TestCreateDedupRefCount(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi1, err := s.Create("", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi2, err := s.Create("", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi1.Name != fi2.Name {
+		t.Fatalf("одинаковое содержимое получило разные имена: %s != %s", fi1.Name, fi2.Name)
+	}
+	meta, err := s.Stat("", fi1.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.RefCount != 2 {
+		t.Fatalf("RefCount = %d, want 2", meta.RefCount)
+	}
+
+	if err = s.Remove("", fi1.Name, ""); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err = s.Stat("", fi1.Name); err != nil {
+		t.Fatal(err)
+	}
+	if meta.RefCount != 1 {
+		t.Fatalf("RefCount после первого Remove = %d, want 1", meta.RefCount)
+	}
+	if _, err = s.Open("", fi1.Name); err != nil {
+		t.Fatalf("блоб не должен быть удален, пока осталась ссылка: %v", err)
+	}
+
+	if err = s.Remove("", fi1.Name, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Stat("", fi1.Name); err != ErrNotFound {
+		t.Fatalf("Stat после снятия последней ссылки: err = %v, want ErrNotFound", err)
+	}
+}
+
+// TestRemoveDeleteKey проверяет, что Remove требует предъявления того же
+// DeleteKey, с которым был сделан Create, и не удаляет блоб без него.
+func TestRemoveDeleteKey(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := s.Create("", strings.NewReader("protected"), WithDeleteKey("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Remove("", fi.Name, "wrong-key"); err != ErrInvalidDeleteKey {
+		t.Fatalf("err = %v, want ErrInvalidDeleteKey", err)
+	}
+	if _, err = s.Open("", fi.Name); err != nil {
+		t.Fatalf("блоб не должен быть удален при неверном ключе: %v", err)
+	}
+
+	if err = s.Remove("", fi.Name, "secret"); err != nil {
+		t.Fatalf("Remove с верным ключом: %v", err)
+	}
+	if _, err = s.Open("", fi.Name); err != ErrNotFound {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
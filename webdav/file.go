@@ -0,0 +1,166 @@
+package webdav
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mdigger/filestore"
+)
+
+// fileInfo реализует os.FileInfo для узла виртуального дерева каталогов.
+type fileInfo struct {
+	name string
+	node *node
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+func (fi *fileInfo) Size() int64 {
+	if fi.node.Dir {
+		return 0
+	}
+	return fi.node.Size
+}
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.node.Dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+func (fi *fileInfo) ModTime() time.Time { return fi.node.ModTime }
+func (fi *fileInfo) IsDir() bool        { return fi.node.Dir }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+// readFile - это уже сохраненный файл, открытый на чтение; содержимое
+// читается прямо из Store.
+type readFile struct {
+	io.ReadSeekCloser
+	name string
+	node *node
+}
+
+func (f *readFile) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (f *readFile) Stat() (os.FileInfo, error)               { return &fileInfo{name: f.name, node: f.node}, nil }
+func (f *readFile) Write(p []byte) (int, error)              { return 0, os.ErrPermission }
+
+// dirFile - это открытый на чтение виртуальный каталог.
+type dirFile struct {
+	node   *node
+	names  []string
+	offset int
+}
+
+func newDirFile(n *node) *dirFile {
+	var names = make([]string, 0, len(n.Children))
+	for name := range n.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &dirFile{node: n, names: names}
+}
+
+func (d *dirFile) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (d *dirFile) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (d *dirFile) Close() error                                 { return nil }
+func (d *dirFile) Stat() (os.FileInfo, error)                   { return &fileInfo{name: "", node: d.node}, nil }
+func (d *dirFile) Write(p []byte) (int, error)                  { return 0, os.ErrPermission }
+
+func (d *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if d.offset >= len(d.names) {
+		if count > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	var remaining = d.names[d.offset:]
+	if count > 0 && count < len(remaining) {
+		remaining = remaining[:count]
+	}
+	var list = make([]os.FileInfo, len(remaining))
+	for i, name := range remaining {
+		list[i] = &fileInfo{name: name, node: d.node.Children[name]}
+	}
+	d.offset += len(remaining)
+	return list, nil
+}
+
+// stagingFile буферизует записываемое содержимое во временном файле и
+// сохраняет его в Store только при закрытии, аналогично Store.Create.
+type stagingFile struct {
+	fs      *FS
+	parent  *node
+	base    string
+	tmp     *os.File
+	oldHash string // хеш заменяемого содержимого, если это перезапись файла
+	closed  bool
+}
+
+// newStagingFile создает файл для записи. Если seed не nil, его содержимое
+// предварительно копируется во временный файл - так обрабатывается
+// дозапись (O_APPEND) к уже существующему файлу. oldHash - это хеш
+// заменяемого содержимого (пусто для нового файла): Close снимет с него
+// ссылку в Store после того, как новое содержимое будет сохранено, чтобы
+// перезапись файла не приводила к утечке ссылок на старый блоб.
+func newStagingFile(fs *FS, parent *node, base string, seed io.ReadCloser, oldHash string) (*stagingFile, error) {
+	tmpfile, err := ioutil.TempFile("", "webdav-staging-")
+	if err != nil {
+		return nil, err
+	}
+	if seed != nil {
+		_, err = io.Copy(tmpfile, seed)
+		seed.Close()
+		if err != nil {
+			tmpfile.Close()
+			os.Remove(tmpfile.Name())
+			return nil, err
+		}
+	}
+	return &stagingFile{fs: fs, parent: parent, base: base, tmp: tmpfile, oldHash: oldHash}, nil
+}
+
+func (f *stagingFile) Write(p []byte) (int, error) { return f.tmp.Write(p) }
+func (f *stagingFile) Read(p []byte) (int, error)  { return f.tmp.Read(p) }
+func (f *stagingFile) Seek(offset int64, whence int) (int64, error) {
+	return f.tmp.Seek(offset, whence)
+}
+func (f *stagingFile) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+
+func (f *stagingFile) Stat() (os.FileInfo, error) {
+	fi, err := f.tmp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: f.base, node: &node{Size: fi.Size(), ModTime: fi.ModTime()}}, nil
+}
+
+// Close сохраняет накопленное содержимое в Store и заносит файл в
+// виртуальное дерево каталогов.
+func (f *stagingFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	defer os.Remove(f.tmp.Name())
+
+	if _, err := f.tmp.Seek(0, io.SeekStart); err != nil {
+		f.tmp.Close()
+		return err
+	}
+	info, err := f.fs.store.Create(storePrefix, f.tmp, filestore.WithFilename(f.base))
+	f.tmp.Close()
+	if err != nil {
+		return err
+	}
+	// это перезапись существующего файла - снимаем ссылку на заменяемый
+	// блоб, иначе при каждом сохранении счетчик ссылок будет только расти
+	if f.oldHash != "" {
+		f.fs.store.Remove(storePrefix, f.oldHash, "")
+	}
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.parent.Children[f.base] = &node{Hash: info.Name, Size: info.Size, ModTime: time.Now()}
+	return f.fs.save()
+}
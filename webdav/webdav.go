@@ -0,0 +1,281 @@
+// Package webdav реализует golang.org/x/net/webdav.FileSystem поверх
+// filestore.Store, так что содержимое хеш-адресного хранилища можно
+// смонтировать любым WebDAV-клиентом.
+//
+// Сам Store хранит файлы плоско, по хешу содержимого, поэтому здесь
+// дополнительно ведется виртуальное дерево каталогов - индекс "имя -> хеш",
+// который сохраняется рядом в отдельном JSON-файле. Запись в Store всегда
+// идет через staging во временный файл с последующим commit-ом через
+// Store.Create, как и во всех остальных местах, где пишется в Store.
+package webdav
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdigger/filestore"
+	"golang.org/x/net/webdav"
+)
+
+// storePrefix - это префикс, под которым адаптер хранит свои файлы в
+// Store, чтобы не пересекаться по пространству имен с остальными
+// потребителями того же хранилища.
+const storePrefix = "webdav"
+
+// node - это запись виртуального дерева каталогов.
+type node struct {
+	Dir     bool      `json:"dir"`
+	Hash    string    `json:"hash,omitempty"` // имя файла в Store, если это не каталог
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"modtime"`
+	// Без omitempty: encoding/json считает пустую map "пустым значением" и
+	// вырезал бы ключ children даже у существующего, но пока пустого
+	// каталога - после перезагрузки индекса такой каталог вернулся бы с
+	// Children == nil и lookup принял бы его за "не каталог".
+	Children map[string]*node `json:"children"`
+}
+
+// FS реализует webdav.FileSystem поверх filestore.Store.
+type FS struct {
+	store     *filestore.Store
+	indexPath string
+
+	mu   sync.Mutex
+	root *node
+}
+
+// NewFS возвращает адаптер WebDAV-файловой системы над store. indexPath -
+// это путь к файлу, в котором сохраняется виртуальное дерево каталогов.
+func NewFS(store *filestore.Store, indexPath string) (*FS, error) {
+	var fs = &FS{store: store, indexPath: indexPath}
+	if err := fs.load(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// load читает индекс каталогов с диска, либо создает пустой корень, если
+// файла индекса еще нет.
+func (fs *FS) load() error {
+	data, err := ioutil.ReadFile(fs.indexPath)
+	if os.IsNotExist(err) {
+		fs.root = &node{Dir: true, Children: map[string]*node{}, ModTime: time.Now()}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var root node
+	if err = json.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	fs.root = &root
+	return nil
+}
+
+// save атомарно перезаписывает индекс каталогов на диске.
+func (fs *FS) save() error {
+	data, err := json.Marshal(fs.root)
+	if err != nil {
+		return err
+	}
+	tmpfile, err := ioutil.TempFile(path.Dir(fs.indexPath), "~webdav-index")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpfile.Name())
+	if _, err = tmpfile.Write(data); err != nil {
+		tmpfile.Close()
+		return err
+	}
+	if err = tmpfile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile.Name(), fs.indexPath)
+}
+
+// segments разбивает и очищает виртуальный путь на составляющие.
+func segments(name string) []string {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil
+	}
+	return strings.Split(strings.Trim(name, "/"), "/")
+}
+
+// lookup находит узел по виртуальному пути, а также его родителя и
+// локальное имя (последний сегмент пути) - это нужно операциям, создающим
+// или удаляющим записи в дереве.
+func (fs *FS) lookup(name string) (parent, n *node, base string, err error) {
+	var parts = segments(name)
+	if len(parts) == 0 {
+		return nil, fs.root, "", nil
+	}
+	n = fs.root
+	for i, p := range parts {
+		if !n.Dir {
+			return nil, nil, "", os.ErrNotExist
+		}
+		if n.Children == nil {
+			// Каталог без детей - это не то же самое, что "не каталог":
+			// после load() индекса, сохраненного до этой правки, у пустого
+			// каталога Children мог прийти nil.
+			n.Children = map[string]*node{}
+		}
+		parent = n
+		base = p
+		child, ok := n.Children[p]
+		if !ok {
+			if i == len(parts)-1 {
+				return parent, nil, base, nil
+			}
+			return nil, nil, "", os.ErrNotExist
+		}
+		n = child
+	}
+	return parent, n, base, nil
+}
+
+// Mkdir создает виртуальный каталог.
+func (fs *FS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	parent, n, base, err := fs.lookup(name)
+	if err != nil {
+		return err
+	}
+	if n != nil {
+		return os.ErrExist
+	}
+	if parent == nil {
+		return os.ErrInvalid // попытка создать корень
+	}
+	parent.Children[base] = &node{
+		Dir:      true,
+		Children: map[string]*node{},
+		ModTime:  time.Now(),
+	}
+	return fs.save()
+}
+
+// Stat возвращает информацию об узле виртуального дерева.
+func (fs *FS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	_, n, base, err := fs.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, os.ErrNotExist
+	}
+	if base == "" {
+		base = "/"
+	}
+	return &fileInfo{name: base, node: n}, nil
+}
+
+// RemoveAll удаляет узел виртуального дерева вместе со всем поддеревом,
+// снимая в Store ссылки на все входящие в него файлы.
+func (fs *FS) RemoveAll(ctx context.Context, name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	parent, n, base, err := fs.lookup(name)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return os.ErrNotExist
+	}
+	if parent == nil {
+		return os.ErrInvalid // нельзя удалить корень
+	}
+	fs.removeContent(n)
+	delete(parent.Children, base)
+	return fs.save()
+}
+
+// removeContent снимает в Store ссылки на все файлы поддерева n.
+func (fs *FS) removeContent(n *node) {
+	if !n.Dir {
+		fs.store.Remove(storePrefix, n.Hash, "")
+		return
+	}
+	for _, child := range n.Children {
+		fs.removeContent(child)
+	}
+}
+
+// Rename перемещает узел виртуального дерева из oldName в newName.
+func (fs *FS) Rename(ctx context.Context, oldName, newName string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	oldParent, n, oldBase, err := fs.lookup(oldName)
+	if err != nil {
+		return err
+	}
+	if n == nil || oldParent == nil {
+		return os.ErrNotExist
+	}
+	newParent, existing, newBase, err := fs.lookup(newName)
+	if err != nil {
+		return err
+	}
+	if existing != nil || newParent == nil {
+		return os.ErrExist
+	}
+	delete(oldParent.Children, oldBase)
+	newParent.Children[newBase] = n
+	return fs.save()
+}
+
+// OpenFile открывает (и при необходимости создает) файл или каталог по
+// виртуальному пути.
+func (fs *FS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	parent, n, base, err := fs.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if n != nil && n.Dir {
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return nil, os.ErrInvalid // каталог нельзя открыть на запись
+		}
+		return newDirFile(n), nil
+	}
+	if n == nil {
+		if flag&os.O_CREATE == 0 || parent == nil {
+			return nil, os.ErrNotExist
+		}
+		return newStagingFile(fs, parent, base, nil, "")
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		var seed io.ReadCloser
+		if flag&os.O_TRUNC == 0 {
+			if seed, err = fs.store.Open(storePrefix, n.Hash); err != nil {
+				return nil, err
+			}
+		}
+		// запоминаем хеш заменяемого содержимого, чтобы Close снял с него
+		// ссылку в Store после того, как новое содержимое будет сохранено
+		return newStagingFile(fs, parent, base, seed, n.Hash)
+	}
+	rc, err := fs.store.Open(storePrefix, n.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return &readFile{ReadSeekCloser: rc, name: base, node: n}, nil
+}
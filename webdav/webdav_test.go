@@ -0,0 +1,46 @@
+package webdav
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdigger/filestore"
+)
+
+// TestEmptyDirSurvivesReload проверяет, что пустой каталог остается
+// каталогом после того, как индекс был сохранен и заново загружен (как
+// после перезапуска процесса) - раньше omitempty на Children приводил к
+// тому, что json отбрасывал пустую map, и lookup принимал такой каталог за
+// "не каталог".
+func TestEmptyDirSurvivesReload(t *testing.T) {
+	store, err := filestore.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexPath := filepath.Join(t.TempDir(), "index.json")
+
+	fs, err := NewFS(store, indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Mkdir(context.Background(), "/empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFS(store, indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = reloaded.Stat(context.Background(), "/empty"); err != nil {
+		t.Fatalf("Stat после перезагрузки индекса: %v", err)
+	}
+
+	f, err := reloaded.OpenFile(context.Background(), "/empty/newfile.txt",
+		os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile(O_CREATE) в пустом каталоге после перезагрузки: %v", err)
+	}
+	f.Close()
+}